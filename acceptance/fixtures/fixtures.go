@@ -0,0 +1,40 @@
+// Package fixtures provides helpers for building the image metadata payloads
+// used by the acceptance suite's daemon and registry fixtures, kept in sync
+// with platform.LayersMetadata and platform.CacheMetadata so that downstream
+// consumers of acceptance/registry don't have to hand-roll their own.
+package fixtures
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// MinifyAppMetadata reads the app image metadata fixture at path, round-trips
+// it through platform.LayersMetadata to strip unnecessary whitespace and
+// validate its shape, and returns the flattened JSON.
+func MinifyAppMetadata(t *testing.T, path string) string {
+	return minify(t, path, &platform.LayersMetadata{})
+}
+
+// MinifyCacheMetadata reads the cache image metadata fixture at path,
+// round-trips it through platform.CacheMetadata, and returns the flattened
+// JSON.
+func MinifyCacheMetadata(t *testing.T, path string) string {
+	return minify(t, path, &platform.CacheMetadata{})
+}
+
+func minify(t *testing.T, path string, metadataStruct interface{}) string {
+	metadata, err := os.ReadFile(path)
+	h.AssertNil(t, err)
+
+	// Unmarshal and marshal to strip unnecessary whitespace
+	h.AssertNil(t, json.Unmarshal(metadata, metadataStruct))
+	flatMetadata, err := json.Marshal(metadataStruct)
+	h.AssertNil(t, err)
+
+	return string(flatMetadata)
+}
@@ -2,10 +2,7 @@ package acceptance
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,12 +10,8 @@ import (
 	"strings"
 	"testing"
 
-	ih "github.com/buildpacks/imgutil/testhelpers"
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/registry"
-
-	"github.com/buildpacks/lifecycle/auth"
-	"github.com/buildpacks/lifecycle/platform"
+	"github.com/buildpacks/lifecycle/acceptance/fixtures"
+	"github.com/buildpacks/lifecycle/acceptance/registry"
 	h "github.com/buildpacks/lifecycle/testhelpers"
 )
 
@@ -44,24 +37,20 @@ type daemonImageFixtures struct {
 	RunImage   string
 }
 
+// targetRegistry accumulates registry.Option values supplied by phase-ops
+// (withSchema1Registry, withBearerAuth, withMTLS, withCredHelper,
+// withMultiArchFixtures) and, once Start is called, starts a
+// registry.Registry configured with them. The registry and fixture
+// management itself lives in acceptance/registry, so that pack, kpack, and
+// the tekton buildpacks tasks can import the same helpers.
 type targetRegistry struct {
-	authConfig      string
-	dockerConfigDir string
-	network         string
-	fixtures        *regImageFixtures
-	registry        *ih.DockerRegistry
-}
+	opts []registry.Option
+	reg  *registry.Registry
 
-type regImageFixtures struct {
-	InaccessibleImage      string
-	ReadOnlyAppImage       string
-	ReadOnlyCacheImage     string
-	ReadOnlyRunImage       string
-	ReadWriteAppImage      string
-	ReadWriteCacheImage    string
-	ReadWriteOtherAppImage string
-	SomeAppImage           string
-	SomeCacheImage         string
+	// fixtures forwards reg.Fixtures, kept so the targetRegistry.fixtures.*
+	// call sites written against the pre-extraction field keep compiling
+	// until those tests are migrated to reg.Fixtures directly.
+	fixtures registry.Fixtures
 }
 
 func NewPhaseTest(t *testing.T, phaseName, testImageDockerContext string, phaseOp ...func(*PhaseTest)) *PhaseTest {
@@ -102,18 +91,29 @@ func newTargetDaemon(t *testing.T) *targetDaemon {
 }
 
 func (p *PhaseTest) RegRepoName(repoName string) string {
-	return p.targetRegistry.registry.RepoName(repoName)
+	return p.targetRegistry.reg.RepoName(repoName)
 }
 
 func (p *PhaseTest) Start(t *testing.T, phaseOp ...func(*testing.T, *PhaseTest)) {
 	p.targetDaemon.createFixtures(t)
 
 	if p.targetRegistry != nil {
-		p.targetRegistry.start(t)
+		opts := append([]registry.Option{registry.WithFromImages(containerBaseImage, containerBaseImageFull)}, p.targetRegistry.opts...)
+		p.targetRegistry.reg = registry.New(
+			t,
+			filepath.Join("testdata", "app_image_metadata.json"),
+			filepath.Join("testdata", "cache_image_metadata.json"),
+			opts...,
+		)
+
+		p.targetRegistry.reg.WriteCredHelper(t, p.containerBinaryDir)
+
 		containerDockerConfigDir := filepath.Join(p.testImageDockerContext, "container", "docker-config")
 		h.AssertNil(t, os.RemoveAll(containerDockerConfigDir))
 		h.AssertNil(t, os.MkdirAll(containerDockerConfigDir, 0755))
-		h.RecursiveCopy(t, p.targetRegistry.dockerConfigDir, containerDockerConfigDir)
+		h.RecursiveCopy(t, p.targetRegistry.reg.DockerConfigDir, containerDockerConfigDir)
+
+		p.targetRegistry.fixtures = p.targetRegistry.reg.Fixtures
 	}
 
 	for _, op := range phaseOp {
@@ -128,9 +128,9 @@ func (p *PhaseTest) Stop(t *testing.T) {
 	p.targetDaemon.removeFixtures(t)
 
 	if p.targetRegistry != nil {
-		p.targetRegistry.stop(t)
+		p.targetRegistry.reg.Stop(t)
 		// remove images that were built locally before being pushed to test registry
-		cleanupDaemonFixtures(t, *p.targetRegistry.fixtures)
+		cleanupDaemonFixtures(t, p.targetRegistry.reg.Fixtures)
 	}
 
 	h.DockerImageRemove(t, p.testImageRef)
@@ -141,198 +141,57 @@ func (d *targetDaemon) createFixtures(t *testing.T) {
 		return
 	}
 
-	var fixtures daemonImageFixtures
+	var imgFixtures daemonImageFixtures
 
-	appMeta := minifyMetadata(t, filepath.Join("testdata", "app_image_metadata.json"), platform.LayersMetadata{})
-	cacheMeta := minifyMetadata(t, filepath.Join("testdata", "cache_image_metadata.json"), platform.CacheMetadata{})
+	appMeta := fixtures.MinifyAppMetadata(t, filepath.Join("testdata", "app_image_metadata.json"))
+	cacheMeta := fixtures.MinifyCacheMetadata(t, filepath.Join("testdata", "cache_image_metadata.json"))
 
-	fixtures.AppImage = "some-app-image-" + h.RandString(10)
+	imgFixtures.AppImage = "some-app-image-" + h.RandString(10)
 	cmd := exec.Command(
 		"docker",
 		"build",
-		"-t", fixtures.AppImage,
+		"-t", imgFixtures.AppImage,
 		"--build-arg", "fromImage="+containerBaseImage,
 		"--build-arg", "metadata="+appMeta,
 		filepath.Join("testdata", "app-image"),
 	) // #nosec G204
 	h.Run(t, cmd)
 
-	fixtures.CacheImage = "some-cache-image-" + h.RandString(10)
+	imgFixtures.CacheImage = "some-cache-image-" + h.RandString(10)
 	cmd = exec.Command(
 		"docker",
 		"build",
-		"-t", fixtures.CacheImage,
+		"-t", imgFixtures.CacheImage,
 		"--build-arg", "fromImage="+containerBaseImage,
 		"--build-arg", "metadata="+cacheMeta,
 		filepath.Join("testdata", "cache-image"),
 	) // #nosec G204
 	h.Run(t, cmd)
 
-	fixtures.RunImage = "some-run-image-" + h.RandString(10)
+	imgFixtures.RunImage = "some-run-image-" + h.RandString(10)
 	cmd = exec.Command(
 		"docker",
 		"build",
-		"-t", fixtures.RunImage,
+		"-t", imgFixtures.RunImage,
 		"--build-arg", "fromImage="+containerBaseImage,
 		filepath.Join("testdata", "cache-image"),
 	) // #nosec G204
 	h.Run(t, cmd)
 
-	d.fixtures = &fixtures
+	d.fixtures = &imgFixtures
 }
 
 func (d *targetDaemon) removeFixtures(t *testing.T) {
 	cleanupDaemonFixtures(t, *d.fixtures)
 }
 
-func (r *targetRegistry) start(t *testing.T) {
-	var err error
-
-	r.dockerConfigDir, err = os.MkdirTemp("", "test.docker.config.dir")
-	h.AssertNil(t, err)
-
-	sharedRegHandler := registry.New(registry.Logger(log.New(io.Discard, "", log.Lshortfile)))
-	r.registry = ih.NewDockerRegistry(
-		ih.WithAuth(r.dockerConfigDir),
-		ih.WithSharedHandler(sharedRegHandler),
-		ih.WithImagePrivileges(),
-	)
-	r.registry.Start(t)
-
-	// if registry is listening on localhost, use host networking to allow containers to reach it
-	r.network = "default"
-	if r.registry.Host == "localhost" {
-		r.network = "host"
-	}
-
-	// Save auth config
-	os.Setenv("DOCKER_CONFIG", r.dockerConfigDir)
-	r.authConfig, err = auth.BuildEnvVar(authn.DefaultKeychain, r.registry.RepoName("some-repo")) // repo name doesn't matter
-	h.AssertNil(t, err)
-
-	r.createFixtures(t)
-}
-
-func (r *targetRegistry) createFixtures(t *testing.T) {
-	var fixtures regImageFixtures
-
-	appMeta := minifyMetadata(t, filepath.Join("testdata", "app_image_metadata.json"), platform.LayersMetadata{})
-	cacheMeta := minifyMetadata(t, filepath.Join("testdata", "cache_image_metadata.json"), platform.CacheMetadata{})
-
-	// With Permissions
-
-	fixtures.InaccessibleImage = r.registry.SetInaccessible("inaccessible-image")
-
-	someReadOnlyAppName := "some-read-only-app-image-" + h.RandString(10)
-	fixtures.ReadOnlyAppImage = buildRegistryImage(
-		t,
-		someReadOnlyAppName,
-		filepath.Join("testdata", "app-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+appMeta,
-	)
-	r.registry.SetReadOnly(someReadOnlyAppName)
-
-	someReadOnlyCacheImage := "some-read-only-cache-image-" + h.RandString(10)
-	fixtures.ReadOnlyCacheImage = buildRegistryImage(
-		t,
-		someReadOnlyCacheImage,
-		filepath.Join("testdata", "cache-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+cacheMeta,
-	)
-	r.registry.SetReadOnly(someReadOnlyCacheImage)
-
-	someRunImageName := "some-read-only-run-image-" + h.RandString(10)
-	buildRegistryImage(
-		t,
-		someRunImageName,
-		filepath.Join("testdata", "cache-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImageFull,
-	)
-	fixtures.ReadOnlyRunImage = r.registry.SetReadOnly(someRunImageName)
-
-	readWriteAppName := "some-read-write-app-image-" + h.RandString(10)
-	fixtures.ReadWriteAppImage = buildRegistryImage(
-		t,
-		readWriteAppName,
-		filepath.Join("testdata", "app-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+appMeta,
-	)
-	r.registry.SetReadWrite(readWriteAppName)
-
-	someReadWriteCacheName := "some-read-write-cache-image-" + h.RandString(10)
-	fixtures.ReadWriteCacheImage = buildRegistryImage(
-		t,
-		someReadWriteCacheName,
-		filepath.Join("testdata", "cache-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+cacheMeta,
-	)
-	r.registry.SetReadWrite(someReadWriteCacheName)
-
-	readWriteOtherAppName := "some-other-read-write-app-image-" + h.RandString(10)
-	fixtures.ReadWriteOtherAppImage = buildRegistryImage(
-		t,
-		readWriteOtherAppName,
-		filepath.Join("testdata", "app-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+appMeta,
-	)
-	r.registry.SetReadWrite(readWriteOtherAppName)
-
-	// Without Permissions
-
-	fixtures.SomeAppImage = buildRegistryImage(
-		t,
-		"some-app-image-"+h.RandString(10),
-		filepath.Join("testdata", "app-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+appMeta,
-	)
-
-	fixtures.SomeCacheImage = buildRegistryImage(
-		t,
-		"some-cache-image-"+h.RandString(10),
-		filepath.Join("testdata", "cache-image"),
-		r.registry,
-		"--build-arg", "fromImage="+containerBaseImage,
-		"--build-arg", "metadata="+cacheMeta,
-	)
-
-	r.fixtures = &fixtures
-}
-
-func (r *targetRegistry) stop(t *testing.T) {
-	r.registry.Stop(t)
-	os.Unsetenv("DOCKER_CONFIG")
-	os.RemoveAll(r.dockerConfigDir)
-}
-
-func buildRegistryImage(t *testing.T, repoName, context string, registry *ih.DockerRegistry, buildArgs ...string) string {
-	// Build image
-	regRepoName := registry.RepoName(repoName)
-	h.DockerBuild(t, regRepoName, context, h.WithArgs(buildArgs...))
-
-	// Push image
-	h.AssertNil(t, h.PushImage(h.DockerCli(t), regRepoName, registry.EncodedLabeledAuth()))
-
-	// Return registry repo name
-	return regRepoName
-}
-
-func cleanupDaemonFixtures(t *testing.T, fixtures interface{}) {
-	v := reflect.ValueOf(fixtures)
+func cleanupDaemonFixtures(t *testing.T, imgFixtures interface{}) {
+	v := reflect.ValueOf(imgFixtures)
 
 	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() != reflect.String {
+			continue
+		}
 		imageName := fmt.Sprintf("%v", v.Field(i).Interface())
 		if imageName == "" {
 			continue
@@ -344,18 +203,6 @@ func cleanupDaemonFixtures(t *testing.T, fixtures interface{}) {
 	}
 }
 
-func minifyMetadata(t *testing.T, path string, metadataStruct interface{}) string {
-	metadata, err := os.ReadFile(path)
-	h.AssertNil(t, err)
-
-	// Unmarshal and marshal to strip unnecessary whitespace
-	h.AssertNil(t, json.Unmarshal(metadata, &metadataStruct))
-	flatMetadata, err := json.Marshal(metadataStruct)
-	h.AssertNil(t, err)
-
-	return string(flatMetadata)
-}
-
 func withoutDaemonFixtures(phaseTest *PhaseTest) {
 	phaseTest.targetDaemon.fixtures = &daemonImageFixtures{}
 }
@@ -363,3 +210,33 @@ func withoutDaemonFixtures(phaseTest *PhaseTest) {
 func withoutRegistry(phaseTest *PhaseTest) {
 	phaseTest.targetRegistry = nil
 }
+
+func withSchema1Registry(phaseTest *PhaseTest) {
+	phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithSchema1())
+}
+
+func withMultiArchFixtures(phaseTest *PhaseTest) {
+	phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithMultiArch())
+}
+
+func withBearerAuth(phaseTest *PhaseTest) {
+	phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithBearerAuth())
+}
+
+func withMTLS(phaseTest *PhaseTest) {
+	phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithMTLS())
+}
+
+func withCredHelper(phaseTest *PhaseTest) {
+	phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithCredHelper())
+}
+
+func withSignedImages(phaseTest *PhaseTest) {
+	phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithSignedImages())
+}
+
+func withRegistryFaults(specs ...registry.FaultSpec) func(*PhaseTest) {
+	return func(phaseTest *PhaseTest) {
+		phaseTest.targetRegistry.opts = append(phaseTest.targetRegistry.opts, registry.WithRegistryFaults(specs...))
+	}
+}
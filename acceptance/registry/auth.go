@@ -0,0 +1,316 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// WithBearerAuth starts a small token issuer alongside the registry and
+// exposes the shared registry handler on a second listener gated behind
+// `Authorization: Bearer <jwt>`, for exercising auth.BuildEnvVar and the
+// lifecycle's registry client against the Docker bearer-token
+// challenge/response flow used by most hosted registries. That listener's
+// address is kept on the unexported bearer server and is not exported from
+// Registry.
+func WithBearerAuth() Option {
+	return func(r *Registry) {
+		r.bearerAuth = &bearerAuthServer{}
+	}
+}
+
+// WithMTLS generates a CA, a server certificate, and a client certificate
+// signed by it into DockerConfigDir, and exposes the shared registry handler
+// on a second listener requiring that client certificate on every
+// connection, so tests can assert the lifecycle honors registries that are
+// only reachable over mutual TLS. That listener's address is kept on the
+// unexported mTLS config and is not exported from Registry.
+func WithMTLS() Option {
+	return func(r *Registry) {
+		r.mTLS = &mTLSConfig{}
+	}
+}
+
+// WithCredHelper makes WriteCredHelper write a real docker-credential-<name>
+// helper script, resolving to this registry's actual credentials, into
+// containerBinaryDir, and a `credHelpers`-style Docker config pointing at
+// it, so tests can assert the lifecycle resolves credentials the same way it
+// would against a real ECR/GCR/ACR credential helper. New does not write
+// them itself; they are written only when WriteCredHelper is called.
+func WithCredHelper() Option {
+	return func(r *Registry) {
+		r.credHelper = &credHelperConfig{}
+	}
+}
+
+// WriteCredHelper writes the fake credential helper script and config for
+// this registry if WithCredHelper was used; it is a no-op otherwise.
+func (r *Registry) WriteCredHelper(t *testing.T, containerBinaryDir string) {
+	if r.credHelper == nil {
+		return
+	}
+	r.credHelper.write(t, containerBinaryDir, r.DockerConfigDir, r.registry.EncodedLabeledAuth(), r.RepoName("some-repo"))
+}
+
+// bearerAuthServer issues short-lived, HS256-signed JWTs for any
+// scope/service requested, mimicking the token endpoint a real registry
+// redirects clients to on a 401, and gates a listener of its own on the
+// shared registry handler so those tokens are actually required.
+type bearerAuthServer struct {
+	Addr string
+
+	issuer *httptest.Server
+	aux    *auxListener
+	secret []byte
+}
+
+func (b *bearerAuthServer) start(t *testing.T, handler http.Handler) {
+	b.secret = []byte(h.RandString(32))
+	b.issuer = httptest.NewServer(http.HandlerFunc(b.issueToken))
+
+	b.aux = startAuxListener(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !b.authorized(req) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="%s"`, b.issuer.URL, req.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}), nil)
+	b.Addr = b.aux.Addr
+}
+
+func (b *bearerAuthServer) stop() {
+	if b.aux != nil {
+		b.aux.stop()
+	}
+	if b.issuer != nil {
+		b.issuer.Close()
+	}
+}
+
+func (b *bearerAuthServer) authorized(req *http.Request) bool {
+	tokenString := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if tokenString == req.Header.Get("Authorization") { // prefix wasn't present
+		return false
+	}
+	token, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
+		return b.secret, nil
+	})
+	return err == nil && token.Valid
+}
+
+func (b *bearerAuthServer) issueToken(w http.ResponseWriter, req *http.Request) {
+	claims := jwt.MapClaims{
+		"iss": "acceptance-test-issuer",
+		"sub": "acceptance-test",
+		"aud": req.URL.Query().Get("service"),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(b.secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Token string `json:"token"`
+	}{Token: signed})
+}
+
+// mTLSConfig generates a self-signed CA, a server certificate, and a client
+// certificate signed by it, and gates a listener of its own on the shared
+// registry handler requiring that client certificate, so tests can assert
+// the lifecycle honors registries only reachable over mutual TLS. TLSConfig
+// is the client-side config (client cert plus the CA to trust) a caller
+// dials Addr with.
+type mTLSConfig struct {
+	Addr string
+
+	CACertPath     string
+	ClientCertPath string
+	ClientKeyPath  string
+	TLSConfig      *tls.Config
+
+	aux *auxListener
+}
+
+func (m *mTLSConfig) start(t *testing.T, dockerConfigDir string, handler http.Handler) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	h.AssertNil(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acceptance-test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	h.AssertNil(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	h.AssertNil(t, err)
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	h.AssertNil(t, err)
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	h.AssertNil(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	h.AssertNil(t, err)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "acceptance-test-client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	h.AssertNil(t, err)
+
+	m.CACertPath = filepath.Join(dockerConfigDir, "ca.pem")
+	m.ClientCertPath = filepath.Join(dockerConfigDir, "client-cert.pem")
+	m.ClientKeyPath = filepath.Join(dockerConfigDir, "client-key.pem")
+	serverCertPath := filepath.Join(dockerConfigDir, "server-cert.pem")
+	serverKeyPath := filepath.Join(dockerConfigDir, "server-key.pem")
+
+	h.AssertNil(t, writePEM(m.CACertPath, "CERTIFICATE", caDER))
+	h.AssertNil(t, writePEM(m.ClientCertPath, "CERTIFICATE", clientDER))
+	h.AssertNil(t, writePEM(serverCertPath, "CERTIFICATE", serverDER))
+
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	h.AssertNil(t, err)
+	h.AssertNil(t, writePEM(m.ClientKeyPath, "EC PRIVATE KEY", clientKeyDER))
+
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	h.AssertNil(t, err)
+	h.AssertNil(t, writePEM(serverKeyPath, "EC PRIVATE KEY", serverKeyDER))
+
+	clientCert, err := tls.LoadX509KeyPair(m.ClientCertPath, m.ClientKeyPath)
+	h.AssertNil(t, err)
+	serverCert, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath)
+	h.AssertNil(t, err)
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(caCert)
+
+	m.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      certPool,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	m.aux = startAuxListener(t, handler, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    certPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	m.Addr = m.aux.Addr
+}
+
+func (m *mTLSConfig) stop() {
+	if m.aux != nil {
+		m.aux.stop()
+	}
+}
+
+func writePEM(path, blockType string, der []byte) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+}
+
+// credHelperConfig writes a real docker-credential-<name> helper script
+// (resolving to this registry's actual credentials for any ServerURL it's
+// asked about) and a `credHelpers`-style Docker config pointing repoName's
+// host at it, so tests can assert the lifecycle shells out to credential
+// helpers the same way it would for a real `docker-credential-ecr-login` or
+// `docker-credential-gcr`.
+type credHelperConfig struct {
+	HelperName string // e.g. "fake-ecr-login"; resolved on PATH as docker-credential-<HelperName>
+}
+
+// write generates docker-credential-<HelperName> into containerBinaryDir as
+// an executable script that echoes encodedLabeledAuth's username/password
+// for any request, and points repoName's host at it from a Docker config.json
+// written to dockerConfigDir.
+func (c *credHelperConfig) write(t *testing.T, containerBinaryDir, dockerConfigDir, encodedLabeledAuth, repoName string) {
+	if c.HelperName == "" {
+		c.HelperName = "fake-helper"
+	}
+
+	labeledAuth, err := decodeLabeledAuth(encodedLabeledAuth)
+	h.AssertNil(t, err)
+
+	helperPath := filepath.Join(containerBinaryDir, "docker-credential-"+c.HelperName)
+	script := fmt.Sprintf(`#!/bin/sh
+# Fake credential helper for acceptance tests: returns this registry's real
+# credentials regardless of which ServerURL it's asked about.
+cat <<'JSON'
+{"Username":%q,"Secret":%q}
+JSON
+`, labeledAuth.Username, labeledAuth.Password)
+	h.AssertNil(t, os.WriteFile(helperPath, []byte(script), 0755)) // #nosec G306 -- must be executable
+
+	configPath := filepath.Join(dockerConfigDir, "config.json")
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if data, err := os.ReadFile(configPath); err == nil {
+		h.AssertNil(t, json.Unmarshal(data, &config))
+	}
+	if config.CredHelpers == nil {
+		config.CredHelpers = map[string]string{}
+	}
+
+	host, _, _ := splitHostRepoTag(repoName)
+	config.CredHelpers[host] = c.HelperName
+
+	configJSON, err := json.Marshal(config)
+	h.AssertNil(t, err)
+	h.AssertNil(t, os.WriteFile(configPath, configJSON, 0600))
+}
+
+func decodeLabeledAuth(encoded string) (struct{ Username, Password string }, error) {
+	var labeledAuth struct{ Username, Password string }
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return labeledAuth, err
+	}
+	err = json.Unmarshal(decoded, &labeledAuth)
+	return labeledAuth, err
+}
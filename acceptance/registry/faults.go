@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultSpec describes the fault WithRegistryFaults should inject for
+// requests matching RepoPrefix (or every request, if RepoPrefix is empty).
+// Faults fire on the AfterNRequests'th matching request (1-indexed; 0 or
+// negative means "every matching request") and, unless Repeat is true,
+// never again afterward.
+type FaultSpec struct {
+	RepoPrefix      string
+	AfterNRequests  int
+	Repeat          bool
+	StatusCode      int           // if set, respond with this status instead of proxying to the registry
+	SlowBodyDelay   time.Duration // if set, sleep this long before writing each chunk of the response body
+	TruncateBlob    bool          // if set, close the connection partway through a blob response
+	ResetConnection bool          // if set, reset the TCP connection instead of responding at all
+}
+
+// WithRegistryFaults wraps the registry's handler with a middleware that
+// injects the given faults (429s, 500s, slow reads, truncated blobs,
+// connection resets) on a per-repo or per-request-count basis, so
+// acceptance tests can assert the lifecycle's registry client performs
+// correct exponential-backoff retries and surfaces terminal errors with
+// actionable messages - behavior that is untestable against a registry that
+// only ever exposes the happy path.
+func WithRegistryFaults(specs ...FaultSpec) Option {
+	return func(r *Registry) {
+		r.faults = append(r.faults, specs...)
+	}
+}
+
+// faultInjector wraps an http.Handler, counting matching requests per spec and
+// injecting the configured FaultSpecs once their AfterNRequests threshold is
+// reached.
+type faultInjector struct {
+	next  http.Handler
+	specs []FaultSpec
+
+	mu     sync.Mutex
+	counts []int // matching request count so far, indexed the same as specs
+}
+
+func newFaultInjector(next http.Handler, specs []FaultSpec) *faultInjector {
+	return &faultInjector{next: next, specs: specs, counts: make([]int, len(specs))}
+}
+
+func (f *faultInjector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	spec, ok := f.matchAndConsume(req.URL.Path)
+	if !ok {
+		f.next.ServeHTTP(w, req)
+		return
+	}
+
+	switch {
+	case spec.ResetConnection:
+		resetConnection(w)
+		return
+	case spec.StatusCode != 0:
+		http.Error(w, http.StatusText(spec.StatusCode), spec.StatusCode)
+		return
+	case spec.SlowBodyDelay != 0 || spec.TruncateBlob:
+		f.serveDegraded(w, req, spec)
+		return
+	default:
+		f.next.ServeHTTP(w, req)
+	}
+}
+
+// matchAndConsume finds the first FaultSpec matching path whose
+// AfterNRequests threshold its own running count has just reached,
+// incrementing the count of every spec matching path. Each spec is counted
+// independently (by its index in specs), even when two specs share a
+// RepoPrefix, so a sequence of distinct specs against the same repo fire
+// after the number of requests each was actually configured for. A spec with
+// Repeat set keeps matching on every subsequent request once triggered.
+func (f *faultInjector) matchAndConsume(path string) (FaultSpec, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var fired FaultSpec
+	found := false
+	for i, spec := range f.specs {
+		if spec.RepoPrefix != "" && !strings.Contains(path, spec.RepoPrefix) {
+			continue
+		}
+
+		f.counts[i]++
+		count := f.counts[i]
+		if found {
+			continue
+		}
+
+		threshold := spec.AfterNRequests
+		if threshold <= 0 || count == threshold || (spec.Repeat && count >= threshold) {
+			fired, found = spec, true
+		}
+	}
+	return fired, found
+}
+
+// serveDegraded proxies the request to the real handler via a
+// response-capturing writer, then replays the captured response to w with
+// the requested degradation applied.
+func (f *faultInjector) serveDegraded(w http.ResponseWriter, req *http.Request, spec FaultSpec) {
+	rec := &recordingWriter{header: http.Header{}}
+	f.next.ServeHTTP(rec, req)
+
+	for k, values := range rec.header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(rec.statusCode)
+
+	body := rec.body.Bytes()
+	if spec.TruncateBlob && len(body) > 0 {
+		body = body[:len(body)/2]
+	}
+
+	const chunkSize = 4096
+	flusher, _ := w.(http.Flusher)
+	for len(body) > 0 {
+		n := chunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		if spec.SlowBodyDelay != 0 {
+			time.Sleep(spec.SlowBodyDelay)
+		}
+		_, _ = w.Write(body[:n])
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+	}
+}
+
+// resetConnection hijacks the underlying connection and closes it abruptly,
+// simulating the TCP resets clients see against an overloaded registry.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	_ = conn.Close()
+}
+
+// recordingWriter captures a response so serveDegraded can replay it with a
+// fault applied, rather than streaming it straight through.
+type recordingWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *recordingWriter) Header() http.Header { return r.header }
+
+func (r *recordingWriter) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *recordingWriter) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+}
@@ -0,0 +1,212 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+const (
+	dockerManifestSchema2MediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestListMediaType    = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociManifestMediaType           = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType              = "application/vnd.oci.empty.v1+json"
+)
+
+// splitHostRepoTag splits a fully-qualified "host[:port]/repo[:tag]" image
+// reference (the shape Registry.RepoName produces) into its host, repo, and
+// tag, defaulting tag to "latest" the way the Docker CLI does when none is
+// given. The host is split off by its leading "/" first, so a host:port
+// isn't mistaken for a repo:tag.
+func splitHostRepoTag(qualifiedRepoName string) (host, repo, tag string) {
+	slash := strings.Index(qualifiedRepoName, "/")
+	host, rest := qualifiedRepoName[:slash], qualifiedRepoName[slash+1:]
+
+	repo, tag = rest, "latest"
+	if idx := strings.LastIndex(rest, ":"); idx >= 0 {
+		repo, tag = rest[:idx], rest[idx+1:]
+	}
+	return host, repo, tag
+}
+
+// fetchManifest GETs the manifest currently stored for repoName, returning
+// its raw bytes, media type, and digest, computing the digest from the body
+// if the registry doesn't return a Docker-Content-Digest header.
+func fetchManifest(t *testing.T, repoName string) (body []byte, mediaType, digest string) {
+	host, repo, tag := splitHostRepoTag(repoName)
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/v2/%s/manifests/%s", host, repo, tag), nil) // #nosec G107
+	h.AssertNil(t, err)
+	req.Header.Set("Accept", dockerManifestSchema2MediaType)
+
+	resp, err := http.DefaultClient.Do(req)
+	h.AssertNil(t, err)
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	h.AssertNil(t, err)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("fetching manifest for %s: %s: %s", repoName, resp.Status, body)
+	}
+
+	mediaType = resp.Header.Get("Content-Type")
+	digest = resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return body, mediaType, digest
+}
+
+// DockerImageDigest resolves repoName's current manifest digest, the way a
+// client looks up the digest to reference an image from a manifest list or
+// signature tag.
+func DockerImageDigest(t *testing.T, repoName string) string {
+	_, _, digest := fetchManifest(t, repoName)
+	return digest
+}
+
+// manifestListWire is the Docker Registry HTTP API v2 wire format for a
+// manifest list, the same shape BuildIndex assembles platform descriptors
+// into before PutManifestList pushes it.
+type manifestListWire struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	MediaType     string                   `json:"mediaType"`
+	Manifests     []manifestDescriptorWire `json:"manifests"`
+}
+
+// manifestDescriptorWire references one platform-specific manifest from a
+// manifest list.
+type manifestDescriptorWire struct {
+	MediaType string       `json:"mediaType"`
+	Size      int          `json:"size"`
+	Digest    string       `json:"digest"`
+	Platform  platformWire `json:"platform"`
+}
+
+type platformWire struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// PutManifestList PUTs a manifest list referencing manifests to repoName.
+func PutManifestList(t *testing.T, repoName string, manifests []manifestDescriptorWire) {
+	host, repo, tag := splitHostRepoTag(repoName)
+
+	body, err := json.Marshal(manifestListWire{
+		SchemaVersion: 2,
+		MediaType:     dockerManifestListMediaType,
+		Manifests:     manifests,
+	})
+	h.AssertNil(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/v2/%s/manifests/%s", host, repo, tag), bytes.NewReader(body)) // #nosec G107
+	h.AssertNil(t, err)
+	req.Header.Set("Content-Type", dockerManifestListMediaType)
+
+	resp, err := http.DefaultClient.Do(req)
+	h.AssertNil(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		t.Fatalf("putting manifest list for %s: %s: %s", repoName, resp.Status, respBody)
+	}
+}
+
+// uploadBlob uploads data to repo on host via the registry's monolithic blob
+// upload (POST to start the session, PUT the body against the returned
+// Location), and returns its digest.
+func uploadBlob(t *testing.T, host, repo string, data []byte) string {
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	postResp, err := http.Post(fmt.Sprintf("http://%s/v2/%s/blobs/uploads/", host, repo), "", nil) // #nosec G107
+	h.AssertNil(t, err)
+	location := postResp.Header.Get("Location")
+	postResp.Body.Close()
+	if location == "" {
+		t.Fatalf("starting blob upload for %s: no Location header in response", repo)
+	}
+	if !strings.Contains(location, "://") {
+		if !strings.HasPrefix(location, "/") {
+			location = "/" + location
+		}
+		location = "http://" + host + location
+	}
+	sep := "?"
+	if strings.Contains(location, "?") {
+		sep = "&"
+	}
+	putURL := location + sep + "digest=" + digest
+
+	req, err := http.NewRequest(http.MethodPut, putURL, bytes.NewReader(data)) // #nosec G107
+	h.AssertNil(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	h.AssertNil(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		t.Fatalf("uploading blob to %s: %s: %s", repo, resp.Status, respBody)
+	}
+
+	return digest
+}
+
+// ociArtifactManifestWire is the OCI Image Manifest wire format PutOCIArtifact
+// uses to attach a detached signature blob to a tag, the convention cosign
+// and Notary v2 both use so a client can discover a signature from the image
+// reference alone.
+type ociArtifactManifestWire struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	MediaType     string              `json:"mediaType"`
+	Config        ociDescriptorWire   `json:"config"`
+	Layers        []ociDescriptorWire `json:"layers"`
+}
+
+type ociDescriptorWire struct {
+	MediaType string `json:"mediaType"`
+	Size      int    `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// PutOCIArtifact uploads data as a blob to repoName's repository and PUTs an
+// OCI image manifest referencing it as the sole layer, tagged as repoName.
+func PutOCIArtifact(t *testing.T, repoName string, data []byte) {
+	host, repo, tag := splitHostRepoTag(repoName)
+
+	emptyConfig := []byte("{}")
+	configDigest := uploadBlob(t, host, repo, emptyConfig)
+	layerDigest := uploadBlob(t, host, repo, data)
+
+	body, err := json.Marshal(ociArtifactManifestWire{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        ociDescriptorWire{MediaType: ociEmptyMediaType, Size: len(emptyConfig), Digest: configDigest},
+		Layers: []ociDescriptorWire{
+			{MediaType: "application/octet-stream", Size: len(data), Digest: layerDigest},
+		},
+	})
+	h.AssertNil(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/v2/%s/manifests/%s", host, repo, tag), bytes.NewReader(body)) // #nosec G107
+	h.AssertNil(t, err)
+	req.Header.Set("Content-Type", ociManifestMediaType)
+
+	resp, err := http.DefaultClient.Do(req)
+	h.AssertNil(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		t.Fatalf("putting OCI artifact manifest for %s: %s: %s", repoName, resp.Status, respBody)
+	}
+}
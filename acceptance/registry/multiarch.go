@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// PlatformSpec identifies one entry of a manifest list, matching the
+// platforms the exporter/analyzer must be able to select a target image for.
+type PlatformSpec struct {
+	OS   string
+	Arch string
+}
+
+// DefaultManifestListPlatforms is the platform set WithMultiArch builds
+// MultiArchAppImage and MultiArchRunImage for. It's limited to platforms a
+// Linux daemon - what this suite's CI and testdata/*-image Dockerfiles
+// target - can actually build via --platform emulation; Windows containers
+// require a real Windows daemon, so callers that need Windows coverage must
+// pass their own platforms explicitly to WithMultiArch.
+var DefaultManifestListPlatforms = []PlatformSpec{
+	{OS: "linux", Arch: "amd64"},
+	{OS: "linux", Arch: "arm64"},
+}
+
+// WithMultiArch additionally pushes MultiArchAppImage and MultiArchRunImage
+// as Docker manifest lists spanning platforms (DefaultManifestListPlatforms
+// when none are given), so acceptance tests can assert the exporter/analyzer
+// select the correct per-platform manifest out of a genuine manifest list.
+func WithMultiArch(platforms ...PlatformSpec) Option {
+	if len(platforms) == 0 {
+		platforms = DefaultManifestListPlatforms
+	}
+	return func(r *Registry) {
+		r.multiArchPlatforms = platforms
+	}
+}
+
+// BuildIndex builds repoName once per platform in platforms against the
+// local daemon, pushes each single-arch image to r, and PUTs a manifest
+// list referencing their digests. It returns the manifest list's repo name.
+func BuildIndex(t *testing.T, r *Registry, repoName, context string, platforms []PlatformSpec, buildArgs ...string) string {
+	indexRepoName := r.registry.RepoName(repoName)
+
+	var manifests []manifestDescriptorWire
+	for _, p := range platforms {
+		platformRepoName := repoName + "-" + p.OS + "-" + p.Arch
+		fullBuildArgs := append(append([]string{}, buildArgs...), "--platform", p.OS+"/"+p.Arch)
+		buildAndPush(t, r, platformRepoName, context, fullBuildArgs...)
+
+		body, mediaType, digest := fetchManifest(t, r.registry.RepoName(platformRepoName))
+		manifests = append(manifests, manifestDescriptorWire{
+			MediaType: mediaType,
+			Size:      len(body),
+			Digest:    digest,
+			Platform:  platformWire{OS: p.OS, Architecture: p.Arch},
+		})
+	}
+
+	PutManifestList(t, indexRepoName, manifests)
+
+	return indexRepoName
+}
+
+func (r *Registry) createMultiArchFixtures(t *testing.T, appMeta, cacheMeta string) {
+	r.Fixtures.MultiArchAppImage = BuildIndex(
+		t, r, "multi-arch-app-image-"+h.RandString(10), filepath.Join("testdata", "app-image"), r.multiArchPlatforms,
+		"--build-arg", "fromImage="+r.fromImage,
+		"--build-arg", "metadata="+appMeta,
+	)
+	r.Fixtures.MultiArchRunImage = BuildIndex(
+		t, r, "multi-arch-run-image-"+h.RandString(10), filepath.Join("testdata", "cache-image"), r.multiArchPlatforms,
+		"--build-arg", "fromImage="+r.fromImageFull,
+	)
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// auxListener serves handler on its own listener, in front of the same
+// in-memory backing store the primary ih.DockerRegistry listens on, so a
+// Registry can expose additional access schemes (bearer-gated, mTLS) that a
+// caller can dial directly, without disturbing the primary listener that
+// createFixtures pushes images through.
+type auxListener struct {
+	Addr string
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// startAuxListener starts handler on a new 127.0.0.1 listener. If tlsConfig
+// is non-nil, the listener requires TLS (and, per tlsConfig.ClientAuth,
+// client certificates) on every connection.
+func startAuxListener(t *testing.T, handler http.Handler, tlsConfig *tls.Config) *auxListener {
+	var ln net.Listener
+	var err error
+	if tlsConfig != nil {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	h.AssertNil(t, err)
+
+	a := &auxListener{
+		Addr:     ln.Addr().String(),
+		listener: ln,
+		server:   &http.Server{Handler: handler}, // #nosec G112 -- acceptance-test fixture, not production-hardened
+	}
+	go a.server.Serve(ln)
+	return a
+}
+
+func (a *auxListener) stop() {
+	_ = a.server.Shutdown(context.Background())
+}
@@ -0,0 +1,232 @@
+// Package registry stands up a local Docker registry and pushes the fixture
+// images the lifecycle's acceptance suite runs against. It is extracted from
+// the acceptance package's former internal helpers (targetRegistry,
+// regImageFixtures, buildRegistryImage, minifyMetadata) so that downstream
+// consumers - pack, kpack, the tekton buildpacks tasks - can import a stable
+// API instead of copy-pasting these helpers into their own
+// lifecycle-integration tests, and stay in sync with schema changes to
+// platform.LayersMetadata / platform.CacheMetadata automatically.
+package registry
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ih "github.com/buildpacks/imgutil/testhelpers"
+	"github.com/google/go-containerregistry/pkg/authn"
+	regserver "github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/buildpacks/lifecycle/acceptance/fixtures"
+	"github.com/buildpacks/lifecycle/auth"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// Fixtures are the images New pushes to the registry it starts, covering the
+// permission combinations (read-only, read-write, inaccessible) and plain
+// images the acceptance suite exercises the lifecycle's registry client
+// against.
+type Fixtures struct {
+	InaccessibleImage      string
+	MultiArchAppImage      string // manifest list spanning the WithMultiArch platforms; set when WithMultiArch is used
+	MultiArchRunImage      string // manifest list spanning the WithMultiArch platforms; set when WithMultiArch is used
+	ReadOnlyAppImage       string
+	ReadOnlyCacheImage     string
+	ReadOnlyRunImage       string
+	ReadWriteAppImage      string
+	ReadWriteCacheImage    string
+	ReadWriteOtherAppImage string
+	SomeAppImage           string
+	SomeCacheImage         string
+	Schema1                Schema1Fixtures // set when WithSchema1 is used
+	Signed                 SignedFixtures  // set when WithSignedImages is used
+}
+
+// Registry is a local Docker registry started for the lifetime of an
+// acceptance test, along with the fixture images pushed to it.
+type Registry struct {
+	AuthConfig      string
+	DockerConfigDir string
+	Network         string
+	Fixtures        Fixtures
+
+	fromImage     string
+	fromImageFull string
+	registry      *ih.DockerRegistry
+
+	schema1            *schema1Backend
+	bearerAuth         *bearerAuthServer
+	mTLS               *mTLSConfig
+	credHelper         *credHelperConfig
+	signing            *signingBackend
+	multiArchPlatforms []PlatformSpec
+	faults             []FaultSpec
+}
+
+// Option configures a Registry before it is started. Options are applied in
+// New, in the order given.
+type Option func(*Registry)
+
+// WithFromImages sets the base images New's fixtures are built FROM, mirroring
+// the containerBaseImage / containerBaseImageFull constants callers would
+// otherwise have to duplicate.
+func WithFromImages(fromImage, fromImageFull string) Option {
+	return func(r *Registry) {
+		r.fromImage = fromImage
+		r.fromImageFull = fromImageFull
+	}
+}
+
+// New starts a local Docker registry, applies opts, and pushes the standard
+// set of Fixtures to it.
+func New(t *testing.T, appMetadataPath, cacheMetadataPath string, opts ...Option) *Registry {
+	r := &Registry{}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	var err error
+	r.DockerConfigDir, err = os.MkdirTemp("", "test.docker.config.dir")
+	h.AssertNil(t, err)
+
+	var sharedHandler http.Handler = regserver.New()
+	if len(r.faults) > 0 {
+		sharedHandler = newFaultInjector(sharedHandler, r.faults)
+	}
+	r.registry = ih.NewDockerRegistry(
+		ih.WithAuth(r.DockerConfigDir),
+		ih.WithSharedHandler(sharedHandler),
+		ih.WithImagePrivileges(),
+	)
+	r.registry.Start(t)
+
+	r.Network = "default"
+	if r.registry.Host == "localhost" {
+		r.Network = "host"
+	}
+
+	os.Setenv("DOCKER_CONFIG", r.DockerConfigDir)
+	r.AuthConfig, err = auth.BuildEnvVar(authn.DefaultKeychain, r.registry.RepoName("some-repo")) // repo name doesn't matter
+	h.AssertNil(t, err)
+
+	if r.schema1 != nil {
+		r.schema1.start(t, r.DockerConfigDir)
+	}
+	if r.bearerAuth != nil {
+		r.bearerAuth.start(t, sharedHandler)
+	}
+	if r.mTLS != nil {
+		r.mTLS.start(t, r.DockerConfigDir, sharedHandler)
+	}
+
+	r.createFixtures(t, appMetadataPath, cacheMetadataPath)
+
+	return r
+}
+
+// Stop tears down the registry and any auxiliary servers started by New.
+func (r *Registry) Stop(t *testing.T) {
+	if r.schema1 != nil {
+		r.schema1.stop(t)
+	}
+	if r.bearerAuth != nil {
+		r.bearerAuth.stop()
+	}
+	if r.mTLS != nil {
+		r.mTLS.stop()
+	}
+
+	r.registry.Stop(t)
+	os.Unsetenv("DOCKER_CONFIG")
+	os.RemoveAll(r.DockerConfigDir)
+}
+
+// RepoName returns repoName qualified with this registry's host, the way
+// images must be referenced to be pulled from it.
+func (r *Registry) RepoName(repoName string) string {
+	return r.registry.RepoName(repoName)
+}
+
+func (r *Registry) createFixtures(t *testing.T, appMetadataPath, cacheMetadataPath string) {
+	var f Fixtures
+
+	appMeta := fixtures.MinifyAppMetadata(t, appMetadataPath)
+	cacheMeta := fixtures.MinifyCacheMetadata(t, cacheMetadataPath)
+
+	f.InaccessibleImage = r.registry.SetInaccessible("inaccessible-image")
+
+	someReadOnlyAppName := "some-read-only-app-image-" + h.RandString(10)
+	f.ReadOnlyAppImage = PushAppImage(t, r, someReadOnlyAppName, r.fromImage, appMeta)
+	r.registry.SetReadOnly(someReadOnlyAppName)
+
+	someReadOnlyCacheImage := "some-read-only-cache-image-" + h.RandString(10)
+	f.ReadOnlyCacheImage = PushCacheImage(t, r, someReadOnlyCacheImage, r.fromImage, cacheMeta)
+	r.registry.SetReadOnly(someReadOnlyCacheImage)
+
+	someRunImageName := "some-read-only-run-image-" + h.RandString(10)
+	PushRunImage(t, r, someRunImageName, r.fromImageFull)
+	f.ReadOnlyRunImage = r.registry.SetReadOnly(someRunImageName)
+
+	readWriteAppName := "some-read-write-app-image-" + h.RandString(10)
+	f.ReadWriteAppImage = PushAppImage(t, r, readWriteAppName, r.fromImage, appMeta)
+	r.registry.SetReadWrite(readWriteAppName)
+
+	someReadWriteCacheName := "some-read-write-cache-image-" + h.RandString(10)
+	f.ReadWriteCacheImage = PushCacheImage(t, r, someReadWriteCacheName, r.fromImage, cacheMeta)
+	r.registry.SetReadWrite(someReadWriteCacheName)
+
+	readWriteOtherAppName := "some-other-read-write-app-image-" + h.RandString(10)
+	f.ReadWriteOtherAppImage = PushAppImage(t, r, readWriteOtherAppName, r.fromImage, appMeta)
+	r.registry.SetReadWrite(readWriteOtherAppName)
+
+	f.SomeAppImage = PushAppImage(t, r, "some-app-image-"+h.RandString(10), r.fromImage, appMeta)
+	f.SomeCacheImage = PushCacheImage(t, r, "some-cache-image-"+h.RandString(10), r.fromImage, cacheMeta)
+
+	if r.schema1 != nil {
+		f.Schema1 = r.schema1.createFixtures(t, r, r.fromImage, r.fromImageFull, appMeta, cacheMeta)
+	}
+	if r.signing != nil {
+		f.Signed = r.signing.createFixtures(t, r, r.fromImage, r.fromImageFull, appMeta)
+	}
+
+	r.Fixtures = f
+
+	if r.multiArchPlatforms != nil {
+		r.createMultiArchFixtures(t, appMeta, cacheMeta)
+	}
+}
+
+// PushAppImage builds testdata/app-image against the local daemon, tagged
+// repoName, and pushes it to r.
+func PushAppImage(t *testing.T, r *Registry, repoName, fromImage, appMeta string) string {
+	return buildAndPush(t, r, repoName, filepath.Join("testdata", "app-image"),
+		"--build-arg", "fromImage="+fromImage,
+		"--build-arg", "metadata="+appMeta,
+	)
+}
+
+// PushCacheImage builds testdata/cache-image against the local daemon,
+// tagged repoName, and pushes it to r.
+func PushCacheImage(t *testing.T, r *Registry, repoName, fromImage, cacheMeta string) string {
+	return buildAndPush(t, r, repoName, filepath.Join("testdata", "cache-image"),
+		"--build-arg", "fromImage="+fromImage,
+		"--build-arg", "metadata="+cacheMeta,
+	)
+}
+
+// PushRunImage builds testdata/cache-image (the run image fixture shares the
+// cache image's Dockerfile) against the local daemon, tagged repoName, and
+// pushes it to r.
+func PushRunImage(t *testing.T, r *Registry, repoName, fromImageFull string) string {
+	return buildAndPush(t, r, repoName, filepath.Join("testdata", "cache-image"),
+		"--build-arg", "fromImage="+fromImageFull,
+	)
+}
+
+func buildAndPush(t *testing.T, r *Registry, repoName, context string, buildArgs ...string) string {
+	regRepoName := r.registry.RepoName(repoName)
+	h.DockerBuild(t, regRepoName, context, h.WithArgs(buildArgs...))
+	h.AssertNil(t, h.PushImage(h.DockerCli(t), regRepoName, r.registry.EncodedLabeledAuth()))
+	return regRepoName
+}
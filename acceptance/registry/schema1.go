@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	ih "github.com/buildpacks/imgutil/testhelpers"
+	regserver "github.com/google/go-containerregistry/pkg/registry"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// schema1MediaType is the manifest media type used by the legacy Docker
+// Registry v2 Schema1 format, which some older registries and mirrors still
+// serve in place of OCI/Schema2 manifests.
+const schema1MediaType = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+
+// Schema1Fixtures mirrors Fixtures, but the images it refers to are only
+// ever retrievable as Schema1 manifests, so acceptance tests can assert how
+// the lifecycle behaves when it encounters the legacy format.
+type Schema1Fixtures struct {
+	AppImage   string
+	CacheImage string
+	RunImage   string
+}
+
+// WithSchema1 additionally starts a registry backend that only serves
+// Schema1 manifests, alongside the default OCI/Schema2 registry New already
+// starts. This mirrors the moby integration-cli approach of running two
+// registry versions side-by-side to cover both manifest schemas.
+func WithSchema1() Option {
+	return func(r *Registry) {
+		r.schema1 = &schema1Backend{}
+	}
+}
+
+// schema1Backend runs a second registry, alongside the default OCI/Schema2
+// registry, that only serves Schema1 manifests.
+type schema1Backend struct {
+	registry *ih.DockerRegistry
+	handler  *schema1Handler
+}
+
+// start starts the schema1 registry, writing its credentials into
+// dockerConfigDir - the same directory the primary registry writes its own
+// credentials into - so a single config.json ends up with auth entries for
+// both registries, and anything that gets dockerConfigDir copied into it
+// (e.g. the lifecycle container under test) can authenticate against either.
+func (s *schema1Backend) start(t *testing.T, dockerConfigDir string) {
+	s.handler = newSchema1Handler(regserver.New(regserver.Logger(log.New(io.Discard, "", log.Lshortfile))))
+	s.registry = ih.NewDockerRegistry(
+		ih.WithAuth(dockerConfigDir),
+		ih.WithSharedHandler(s.handler),
+		ih.WithImagePrivileges(),
+	)
+	s.registry.Start(t)
+}
+
+func (s *schema1Backend) stop(t *testing.T) {
+	s.registry.Stop(t)
+}
+
+func (s *schema1Backend) createFixtures(t *testing.T, r *Registry, fromImage, fromImageFull, appMeta, cacheMeta string) Schema1Fixtures {
+	return Schema1Fixtures{
+		AppImage: s.pushSchema1Image(t, "some-schema1-app-image-"+h.RandString(10), filepath.Join("testdata", "app-image"),
+			"--build-arg", "fromImage="+fromImage,
+			"--build-arg", "metadata="+appMeta,
+		),
+		CacheImage: s.pushSchema1Image(t, "some-schema1-cache-image-"+h.RandString(10), filepath.Join("testdata", "cache-image"),
+			"--build-arg", "fromImage="+fromImage,
+			"--build-arg", "metadata="+cacheMeta,
+		),
+		RunImage: s.pushSchema1Image(t, "some-schema1-run-image-"+h.RandString(10), filepath.Join("testdata", "cache-image"),
+			"--build-arg", "fromImage="+fromImageFull,
+		),
+	}
+}
+
+// pushSchema1Image builds repoName against the local daemon, pushes it to
+// the schema1 registry, then rewrites what the handler serves for it to a
+// synthesized Schema1 manifest, so tests can exercise the lifecycle against
+// a registry that predates Schema2/OCI support.
+func (s *schema1Backend) pushSchema1Image(t *testing.T, repoName, context string, buildArgs ...string) string {
+	regRepoName := s.registry.RepoName(repoName)
+	h.DockerBuild(t, regRepoName, context, h.WithArgs(buildArgs...))
+	h.AssertNil(t, h.PushImage(h.DockerCli(t), regRepoName, s.registry.EncodedLabeledAuth()))
+	h.AssertNil(t, s.handler.convertToSchema1(regRepoName))
+
+	return regRepoName
+}
+
+// schema1Handler wraps a Schema2/OCI registry.New handler, intercepting
+// manifest GETs for repos that have been converted via convertToSchema1 and
+// serving a synthesized Schema1 manifest instead. Every other request
+// (blobs, uploads, unconverted manifests) is passed through unchanged.
+type schema1Handler struct {
+	next http.Handler
+
+	mu        sync.Mutex
+	manifests map[string][]byte // repo -> synthesized schema1 manifest bytes
+}
+
+func newSchema1Handler(next http.Handler) *schema1Handler {
+	return &schema1Handler{next: next, manifests: map[string][]byte{}}
+}
+
+func (h *schema1Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		if repo, ok := manifestRepo(req.URL.Path); ok {
+			h.mu.Lock()
+			manifest, found := h.manifests[repo]
+			h.mu.Unlock()
+			if found {
+				w.Header().Set("Content-Type", schema1MediaType)
+				w.Header().Set("Docker-Content-Digest", digestOf(manifest))
+				_, _ = w.Write(manifest)
+				return
+			}
+		}
+	}
+	h.next.ServeHTTP(w, req)
+}
+
+// convertToSchema1 fetches the manifest currently stored for repoName
+// (pushed as Schema2 by the daemon) from the registry at repoName's host,
+// rewrites it into a minimal Schema1 manifest referencing the same layers,
+// and keys it so future GETs for repoName are served from this handler
+// instead of being passed through.
+func (h *schema1Handler) convertToSchema1(repoName string) error {
+	host, repo, tag := splitHostRepoTag(repoName)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/v2/%s/manifests/%s", host, repo, tag)) // #nosec G107
+	if err != nil {
+		return fmt.Errorf("fetching schema2 manifest for conversion: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var schema2Manifest struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&schema2Manifest); err != nil {
+		return fmt.Errorf("decoding schema2 manifest: %w", err)
+	}
+
+	schema1Manifest := struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		Name          string `json:"name"`
+		Tag           string `json:"tag"`
+		Architecture  string `json:"architecture"`
+		FSLayers      []struct {
+			BlobSum string `json:"blobSum"`
+		} `json:"fsLayers"`
+	}{
+		SchemaVersion: 1,
+		Name:          repo,
+		Tag:           tag,
+		Architecture:  "amd64",
+	}
+	for _, layer := range schema2Manifest.Layers {
+		schema1Manifest.FSLayers = append(schema1Manifest.FSLayers, struct {
+			BlobSum string `json:"blobSum"`
+		}{BlobSum: layer.Digest})
+	}
+
+	manifestBytes, err := json.Marshal(schema1Manifest)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.manifests[repo] = manifestBytes
+	h.mu.Unlock()
+
+	return nil
+}
+
+// manifestRepo extracts the repo name from a "/v2/<repo>/manifests/<ref>"
+// request path, returning ok=false for any other path shape.
+func manifestRepo(path string) (repo string, ok bool) {
+	const prefix, infix = "/v2/", "/manifests/"
+	if !strings.HasPrefix(path, prefix) || !strings.Contains(path, infix) {
+		return "", false
+	}
+	repo = strings.TrimPrefix(path, prefix)
+	repo = repo[:strings.Index(repo, infix)]
+	return repo, repo != ""
+}
+
+func splitRepoTag(repoName string) (repo, tag string) {
+	idx := strings.LastIndex(repoName, ":")
+	if idx < 0 {
+		return repoName, "latest"
+	}
+	return repoName[:idx], repoName[idx+1:]
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
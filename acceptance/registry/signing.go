@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// SignedFixtures are signed variants of the registry's plain image fixtures,
+// populated when WithSignedImages is used. Each variant is pushed alongside
+// its signature, uploaded as an OCI artifact tagged "sha256-<digest>.sig",
+// the way cosign and Notary v2 both attach signatures to an image today.
+type SignedFixtures struct {
+	CosignPublicKeyPath    string
+	CosignSignedRunImage   string
+	CosignSignedAppImage   string
+	CosignTamperedRunImage string // signed, then re-pushed without re-signing, so its signature no longer matches
+	NotaryPublicKeyPath    string
+	NotarySignedRunImage   string
+}
+
+// WithSignedImages additionally pushes cosign-signed and Notary v2-signed
+// variants of the run and app image fixtures, generating an ephemeral
+// keypair for each scheme and writing its public key (the private key is
+// kept in memory only) into DockerConfigDir, so acceptance tests can
+// assert the exporter/analyzer's `--verify-run-image-signature` mode
+// enforces supply-chain policy on the run image before rebasing.
+func WithSignedImages() Option {
+	return func(r *Registry) {
+		r.signing = &signingBackend{}
+	}
+}
+
+type signingBackend struct {
+	cosignKey *ecdsa.PrivateKey
+	notaryKey *ecdsa.PrivateKey
+}
+
+func (s *signingBackend) createFixtures(t *testing.T, r *Registry, fromImage, fromImageFull, appMeta string) SignedFixtures {
+	var err error
+	s.cosignKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	h.AssertNil(t, err)
+	s.notaryKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	h.AssertNil(t, err)
+
+	var f SignedFixtures
+	f.CosignPublicKeyPath = filepath.Join(r.DockerConfigDir, "cosign.pub")
+	h.AssertNil(t, writePublicKey(f.CosignPublicKeyPath, &s.cosignKey.PublicKey))
+
+	f.NotaryPublicKeyPath = filepath.Join(r.DockerConfigDir, "notary.pub")
+	h.AssertNil(t, writePublicKey(f.NotaryPublicKeyPath, &s.notaryKey.PublicKey))
+
+	f.CosignSignedRunImage = PushRunImage(t, r, "some-signed-run-image-"+h.RandString(10), fromImageFull)
+	s.sign(t, f.CosignSignedRunImage, s.cosignKey)
+
+	f.CosignSignedAppImage = PushAppImage(t, r, "some-signed-app-image-"+h.RandString(10), fromImage, appMeta)
+	s.sign(t, f.CosignSignedAppImage, s.cosignKey)
+
+	f.NotarySignedRunImage = PushRunImage(t, r, "some-notary-signed-run-image-"+h.RandString(10), fromImageFull)
+	s.sign(t, f.NotarySignedRunImage, s.notaryKey)
+
+	tamperedRunImageName := "some-tampered-run-image-" + h.RandString(10)
+	f.CosignTamperedRunImage = PushRunImage(t, r, tamperedRunImageName, fromImageFull)
+	s.sign(t, f.CosignTamperedRunImage, s.cosignKey)
+	// re-push without re-signing, so the uploaded signature no longer matches the image's digest
+	PushRunImage(t, r, tamperedRunImageName, fromImage)
+
+	return f
+}
+
+// sign uploads a detached signature over repoName's current digest as an
+// OCI artifact tagged "sha256-<digest>.sig" in repoName's OWN repository,
+// the convention cosign and Notary v2 both use so that clients can discover
+// a signature from the image reference alone.
+func (s *signingBackend) sign(t *testing.T, repoName string, key *ecdsa.PrivateKey) {
+	digest := DockerImageDigest(t, repoName)
+	sigTag := strings.Replace(digest, "sha256:", "sha256-", 1) + ".sig"
+
+	host, repo, _ := splitHostRepoTag(repoName)
+	sigRepoName := fmt.Sprintf("%s/%s:%s", host, repo, sigTag)
+
+	sum := sha256.Sum256([]byte(digest))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	h.AssertNil(t, err)
+
+	PutOCIArtifact(t, sigRepoName, signature)
+}
+
+func writePublicKey(path string, pub *ecdsa.PublicKey) error {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+}